@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestResult is one request's outcome, the unit both the load generator
+// and the latency-mode ticker fold into a summary.
+type requestResult struct {
+	Time     time.Time
+	Status   int
+	Err      string
+	Latency  time.Duration
+	BytesIn  int64
+	BytesOut int64
+}
+
+// doRequest fires one request against targetURL and reports how it went.
+// Transport errors (connection refused, timeout, ...) are reported as a
+// zero status with Err set, same as the load balancer's own ErrorHandler
+// reports a backend failure as a trace with HealthErr set.
+func doRequest(client *http.Client, method, targetURL string, body string) requestResult {
+	start := time.Now()
+
+	var bodyReader io.Reader
+	var bytesIn int64
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+		bytesIn = int64(len(body))
+	}
+
+	req, err := http.NewRequest(method, targetURL, bodyReader)
+	if err != nil {
+		return requestResult{Time: start, Err: err.Error(), Latency: time.Since(start)}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return requestResult{Time: start, Err: err.Error(), Latency: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	bytesOut, _ := io.Copy(io.Discard, resp.Body)
+
+	return requestResult{
+		Time:     start,
+		Status:   resp.StatusCode,
+		Latency:  time.Since(start),
+		BytesIn:  bytesIn,
+		BytesOut: bytesOut,
+	}
+}
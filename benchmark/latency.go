@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// runLatencyMode fires a single request every interval instead of
+// holding cfg.concurrency connections open, and reports the jitter between
+// the interval asked for and the interval actually achieved (firing the next
+// request is itself delayed by how long the previous one took plus the
+// client and network scheduling involved). Useful for judging how sensitive
+// a backend or policy is to timing drift under light, steady load rather
+// than saturation.
+func runLatencyMode(cfg loadConfig, interval time.Duration) *summary {
+	client := &http.Client{Timeout: cfg.timeout}
+	deadline := time.Now().Add(cfg.duration)
+
+	s := newSummary()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sent int64
+	var lastFire time.Time
+	for fire := range ticker.C {
+		if !lastFire.IsZero() {
+			jitter := fire.Sub(lastFire) - interval
+			fmt.Printf("%s  jitter=%-10s ", fire.Format("15:04:05.000"), jitter.Round(time.Microsecond))
+		} else {
+			fmt.Printf("%s  jitter=%-10s ", fire.Format("15:04:05.000"), "n/a")
+		}
+		lastFire = fire
+
+		r := doRequest(client, cfg.method, cfg.url, cfg.body)
+		if r.Err != "" {
+			fmt.Printf("error=%s\n", r.Err)
+		} else {
+			fmt.Printf("status=%d latency=%s\n", r.Status, r.Latency.Round(time.Microsecond))
+		}
+		s.record(r, cfg.ndjson)
+
+		sent++
+		if time.Now().After(deadline) || (cfg.count > 0 && sent >= cfg.count) {
+			return s
+		}
+	}
+	return s
+}
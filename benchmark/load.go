@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadConfig is what every mode needs to know to fire requests: target,
+// how hard to push, and for how long.
+type loadConfig struct {
+	url         string
+	method      string
+	body        string
+	timeout     time.Duration
+	concurrency int
+	qps         float64 // 0 = unlimited
+	duration    time.Duration
+	count       int64 // 0 = unlimited, bounded by duration instead
+	ndjson      bool
+}
+
+// runLoad drives cfg.concurrency workers in a closed loop (each fires a
+// request, waits for the response, then fires the next) against cfg.url
+// until cfg.duration elapses or cfg.count requests have been sent, whichever
+// comes first. When cfg.qps is set, workers share a ticker so the aggregate
+// rate is capped regardless of concurrency. Results are folded into a
+// summary as they arrive rather than buffered, so a long run costs no more
+// memory than a short one.
+func runLoad(cfg loadConfig) *summary {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+
+	var limiter *time.Ticker
+	if cfg.qps > 0 {
+		limiter = time.NewTicker(time.Duration(float64(time.Second) / cfg.qps))
+		defer limiter.Stop()
+	}
+
+	client := &http.Client{Timeout: cfg.timeout}
+	results := make(chan requestResult, 256)
+	var sent int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if cfg.count > 0 && atomic.AddInt64(&sent, 1) > cfg.count {
+					return
+				}
+				if limiter != nil {
+					select {
+					case <-limiter.C:
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				r := doRequest(client, cfg.method, cfg.url, cfg.body)
+				select {
+				case results <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	s := newSummary()
+	for r := range results {
+		s.record(r, cfg.ndjson)
+	}
+	return s
+}
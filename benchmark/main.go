@@ -0,0 +1,66 @@
+// Command benchmark drives the load balancer (or any HTTP backend) at a
+// target concurrency or QPS and reports latency and throughput, so an
+// operator can validate a selection policy or health-check configuration
+// without reaching for an external load-testing tool.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	url := flag.String("url", "", "target URL, e.g. https://localhost:8443/")
+	method := flag.String("method", "GET", "HTTP method")
+	body := flag.String("body", "", "request body, if any")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+
+	concurrency := flag.Int("c", 10, "number of concurrent workers")
+	qps := flag.Float64("q", 0, "target aggregate requests/sec across all workers (0 = unlimited)")
+	duration := flag.Duration("d", 10*time.Second, "how long to run")
+	count := flag.Int64("n", 0, "stop after this many requests (0 = unbounded, governed by -d instead)")
+	ndjson := flag.Bool("ndjson", false, "print one JSON line per request in addition to the summary")
+
+	mode := flag.String("mode", "load", "load | latency | ramp")
+	latencyInterval := flag.Duration("latency-interval", time.Second, "latency mode: how often to fire a single request")
+	rampStep := flag.Int("ramp-step", 5, "ramp mode: concurrency added at each step")
+	rampInterval := flag.Duration("ramp-interval", 10*time.Second, "ramp mode: how long each step runs")
+	rampMax := flag.Int("ramp-max", 0, "ramp mode: stop stepping once concurrency reaches this (0 = no explicit ceiling)")
+	flag.Parse()
+
+	if *url == "" {
+		fmt.Fprintln(os.Stderr, "benchmark: -url is required")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig{
+		url:         *url,
+		method:      *method,
+		body:        *body,
+		timeout:     *timeout,
+		concurrency: *concurrency,
+		qps:         *qps,
+		duration:    *duration,
+		count:       *count,
+		ndjson:      *ndjson,
+	}
+
+	start := time.Now()
+	var s *summary
+
+	switch *mode {
+	case "latency":
+		s = runLatencyMode(cfg, *latencyInterval)
+	case "ramp":
+		s = runRamp(cfg, rampConfig{step: *rampStep, interval: *rampInterval, max: *rampMax})
+	case "load":
+		s = runLoad(cfg)
+	default:
+		fmt.Fprintf(os.Stderr, "benchmark: unknown -mode %q\n", *mode)
+		os.Exit(1)
+	}
+
+	s.print(time.Since(start))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// rampConfig describes a staircase load: starting at rampStep concurrent
+// workers, add rampStep more every rampInterval until rampMax is reached or
+// the run's overall duration runs out, reporting one summary line per step.
+type rampConfig struct {
+	step     int
+	interval time.Duration
+	max      int
+}
+
+// runRamp steps concurrency up over time instead of holding it fixed, so an
+// operator can see where a policy or backend starts to fall over rather than
+// only how it holds up at one fixed concurrency. cfg.duration (-d) bounds the
+// overall run the same way it does for every other mode; ramp.max (-ramp-max)
+// additionally stops it once concurrency reaches that ceiling, whichever
+// comes first.
+func runRamp(cfg loadConfig, ramp rampConfig) *summary {
+	total := newSummary()
+	fmt.Printf("%-6s %-10s %-8s %-10s %-10s %-10s\n", "conn", "requests", "rps", "p50", "p99", "errors")
+
+	var deadline time.Time
+	if cfg.duration > 0 {
+		deadline = time.Now().Add(cfg.duration)
+	}
+
+	for concurrency := ramp.step; ; concurrency += ramp.step {
+		if ramp.max > 0 && concurrency > ramp.max {
+			break
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			break
+		}
+
+		step := cfg
+		step.concurrency = concurrency
+		step.duration = ramp.interval
+		step.count = 0
+		if !deadline.IsZero() {
+			if remaining := time.Until(deadline); remaining < step.duration {
+				step.duration = remaining
+			}
+		}
+
+		start := time.Now()
+		s := runLoad(step)
+		elapsed := time.Since(start)
+
+		fmt.Printf("%-6d %-10d %-8.1f %-10s %-10s %-10d\n",
+			concurrency,
+			s.count,
+			float64(s.count)/elapsed.Seconds(),
+			s.hist.Quantile(0.5).Round(time.Microsecond),
+			s.hist.Quantile(0.99).Round(time.Microsecond),
+			s.errors,
+		)
+
+		total.count += s.count
+		total.status2x += s.status2x
+		total.status4x += s.status4x
+		total.status5x += s.status5x
+		total.errors += s.errors
+		total.bytesIn += s.bytesIn
+		total.bytesOut += s.bytesOut
+		total.hist.Merge(s.hist)
+		if total.min == 0 || (s.min != 0 && s.min < total.min) {
+			total.min = s.min
+		}
+		if s.max > total.max {
+			total.max = s.max
+		}
+
+		if ramp.max <= 0 && deadline.IsZero() && concurrency >= 64 {
+			// No ceiling and no overall duration were given: stop somewhere
+			// sane rather than ramping forever against whatever's on the
+			// other end of --url.
+			break
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunRampHonorsOverallDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cfg := loadConfig{
+		url:      srv.URL,
+		method:   http.MethodGet,
+		timeout:  time.Second,
+		duration: 150 * time.Millisecond,
+	}
+	ramp := rampConfig{step: 5, interval: 100 * time.Millisecond}
+
+	start := time.Now()
+	runRamp(cfg, ramp)
+	elapsed := time.Since(start)
+
+	// Before -d was honored, runRamp ignored cfg.duration entirely and
+	// ramped all the way to the hardcoded 64-worker fallback ceiling
+	// (13 steps of 5 workers, ~1.3s at this interval) whenever no -ramp-max
+	// was given.
+	if elapsed > time.Second {
+		t.Fatalf("runRamp ran for %s with -d=150ms and no -ramp-max, want it bounded by the overall duration", elapsed)
+	}
+}
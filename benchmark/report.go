@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/KostiantynYarosh/load-balancer/histogram"
+)
+
+// quantilesReported are the latency percentiles printed in the summary.
+var quantilesReported = []float64{0.5, 0.9, 0.99, 0.999}
+
+// summary accumulates per-request results into the fixed-memory aggregate a
+// run prints at the end: counts by status class, byte totals, and a latency
+// histogram rather than a slice of every sample, so a multi-hour run costs no
+// more memory than a ten-second one.
+type summary struct {
+	count    int64
+	status2x int64
+	status4x int64
+	status5x int64
+	errors   int64
+	bytesIn  int64
+	bytesOut int64
+	min      time.Duration
+	max      time.Duration
+	hist     *histogram.Histogram
+}
+
+func newSummary() *summary {
+	return &summary{hist: histogram.New()}
+}
+
+// record folds one requestResult into the summary and, when ndjson is true,
+// immediately prints it as a single NDJSON line.
+func (s *summary) record(r requestResult, ndjson bool) {
+	s.count++
+	s.bytesIn += r.BytesIn
+	s.bytesOut += r.BytesOut
+
+	if r.Err != "" {
+		s.errors++
+	} else {
+		switch r.Status / 100 {
+		case 2:
+			s.status2x++
+		case 4:
+			s.status4x++
+		case 5:
+			s.status5x++
+		}
+		s.hist.Observe(r.Latency)
+		if s.min == 0 || r.Latency < s.min {
+			s.min = r.Latency
+		}
+		if r.Latency > s.max {
+			s.max = r.Latency
+		}
+	}
+
+	if ndjson {
+		json.NewEncoder(os.Stdout).Encode(r)
+	}
+}
+
+// print renders the summary the way an operator reads it at the end of a
+// run: totals, status breakdown, RPS, latency quantiles, and bytes moved.
+func (s *summary) print(elapsed time.Duration) {
+	rps := float64(s.count) / elapsed.Seconds()
+
+	fmt.Printf("\nRequests:    %d (%d errors)\n", s.count, s.errors)
+	fmt.Printf("Status:      2xx=%d  4xx=%d  5xx=%d\n", s.status2x, s.status4x, s.status5x)
+	fmt.Printf("Elapsed:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("RPS:         %.1f\n", rps)
+	fmt.Printf("Latency:     min=%s max=%s\n", s.min.Round(time.Microsecond), s.max.Round(time.Microsecond))
+	for _, q := range quantilesReported {
+		fmt.Printf("  p%-5v %s\n", q*100, s.hist.Quantile(q).Round(time.Microsecond))
+	}
+	fmt.Printf("Bytes:       in=%d out=%d\n", s.bytesIn, s.bytesOut)
+}
@@ -0,0 +1,49 @@
+// Package config loads the load balancer's backend list from disk. It knows
+// nothing about reverse proxies, health checks, or metrics: it is just the
+// JSON shape on disk plus the defaulting that doesn't depend on any runtime
+// state, so both the startup path and the hot-reload watcher can share it.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ServerConfig is one backend entry as it appears in the servers file.
+// Fields left zero are defaulted by the caller (see lb's applyServerDefaults)
+// since the sane default for a probe timeout, say, depends on package lb's
+// own constants, not config's.
+type ServerConfig struct {
+	Id                       int
+	URL                      string
+	MaximumActiveConnections int64
+
+	ProbePath        string
+	ProbeMethod      string
+	ExpectedStatus   []int
+	ExpectedBody     string
+	ProbeTimeoutSec  int
+	ProbeIntervalSec int
+	RiseThreshold    int
+	FallThreshold    int
+}
+
+// Config is the top-level shape of the servers file.
+type Config struct {
+	Servers []ServerConfig
+}
+
+// Load reads and parses the servers file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,89 @@
+// Package histogram implements a fixed-memory latency histogram: bucket
+// boundaries sit at powers of (1+epsilon), so memory is constant regardless
+// of request volume and any quantile read off it is within roughly epsilon of
+// the true value. Originally built for the load balancer's own request
+// metrics, it's plain enough to reuse anywhere that needs streaming latency
+// quantiles without buffering every observation (e.g. the benchmark tool).
+package histogram
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	epsilon  = 0.05
+	minNanos = 100_000        // 100us
+	maxNanos = 60_000_000_000 // 60s
+)
+
+// Histogram is a fixed-size latency histogram safe for concurrent
+// Observe/Quantile calls. Observe never allocates; Quantile allocates one
+// snapshot of the bucket counts per call.
+type Histogram struct {
+	logBase float64
+	buckets []int64 // buckets[0] holds everything below minNanos
+}
+
+// New builds an empty Histogram.
+func New() *Histogram {
+	logBase := math.Log(1 + epsilon)
+	n := int(math.Ceil(math.Log(float64(maxNanos)/minNanos)/logBase)) + 1
+	return &Histogram{logBase: logBase, buckets: make([]int64, n+1)}
+}
+
+// Observe records one latency sample.
+func (h *Histogram) Observe(d time.Duration) {
+	nanos := float64(d.Nanoseconds())
+	if nanos < minNanos {
+		atomic.AddInt64(&h.buckets[0], 1)
+		return
+	}
+	idx := 1 + int(math.Log(nanos/minNanos)/h.logBase)
+	if idx >= len(h.buckets) {
+		idx = len(h.buckets) - 1
+	}
+	atomic.AddInt64(&h.buckets[idx], 1)
+}
+
+// Merge folds other's observations into h. Both must have been built with
+// New() (same bucket layout); Merge panics otherwise.
+func (h *Histogram) Merge(other *Histogram) {
+	if len(h.buckets) != len(other.buckets) {
+		panic("histogram: Merge between incompatible histograms")
+	}
+	for i := range other.buckets {
+		atomic.AddInt64(&h.buckets[i], atomic.LoadInt64(&other.buckets[i]))
+	}
+}
+
+// Quantile returns the smallest bucket upper bound whose cumulative count
+// covers at least fraction q of all observations, or 0 if none were made.
+// When that is the below-minNanos bucket, it returns minNanos/2 instead.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	counts := make([]int64, len(h.buckets))
+	var total int64
+	for i := range h.buckets {
+		counts[i] = atomic.LoadInt64(&h.buckets[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := int64(math.Ceil(q * float64(total)))
+	var cum int64
+	for i, c := range counts {
+		cum += c
+		if cum < target {
+			continue
+		}
+		if i == 0 {
+			return time.Duration(minNanos / 2)
+		}
+		upperNanos := minNanos * math.Exp(float64(i)*h.logBase)
+		return time.Duration(upperNanos)
+	}
+	return time.Duration(maxNanos)
+}
@@ -0,0 +1,89 @@
+package histogram
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuantileWithinEpsilon(t *testing.T) {
+	h := New()
+	const n = 10000
+	for i := 1; i <= n; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		got := h.Quantile(q)
+		want := time.Duration(q*n) * time.Millisecond
+		diff := math.Abs(float64(got-want)) / float64(want)
+		if diff > epsilon*2 {
+			t.Errorf("Quantile(%v) = %v, want ~%v (relative error %.3f > %v)", q, got, want, diff, epsilon*2)
+		}
+	}
+}
+
+func TestQuantileEmpty(t *testing.T) {
+	h := New()
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile on empty histogram = %v, want 0", got)
+	}
+}
+
+func TestQuantileBelowMinNanos(t *testing.T) {
+	h := New()
+	h.Observe(10 * time.Microsecond)
+	if got := h.Quantile(1); got <= 0 || got >= minNanos {
+		t.Errorf("Quantile for a single sub-minNanos sample = %v, want in (0, %v)", got, time.Duration(minNanos))
+	}
+}
+
+func TestMergeCombinesCounts(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 100; i++ {
+		a.Observe(time.Millisecond)
+	}
+	for i := 0; i < 100; i++ {
+		b.Observe(time.Second)
+	}
+
+	a.Merge(b)
+
+	if got := a.Quantile(0.5); got < time.Millisecond || got > 2*time.Millisecond {
+		t.Errorf("median after merge = %v, want close to 1ms (merge should keep the lower half at the 1ms samples)", got)
+	}
+	if got := a.Quantile(1); got < 900*time.Millisecond {
+		t.Errorf("p100 after merge = %v, want close to 1s", got)
+	}
+}
+
+func TestMergeIncompatibleHistogramsPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Merge between a mismatched bucket layout did not panic")
+		}
+	}()
+
+	h := &Histogram{logBase: New().logBase, buckets: make([]int64, 3)}
+	h.Merge(New())
+}
+
+func TestObserveConcurrentSafe(t *testing.T) {
+	h := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				h.Observe(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := h.Quantile(1); got == 0 {
+		t.Error("Quantile(1) after concurrent Observe calls = 0, want a nonzero duration")
+	}
+}
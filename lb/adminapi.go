@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/KostiantynYarosh/load-balancer/config"
+)
+
+// serverView is the JSON-safe projection of a Server returned by the admin
+// API: Server itself holds a reverse proxy and several atomic/mutex fields
+// that don't marshal cleanly (or shouldn't be exposed at all).
+type serverView struct {
+	Id                       int     `json:"id"`
+	URL                      string  `json:"url"`
+	MaximumActiveConnections int64   `json:"maximumActiveConnections"`
+	CurrentActiveConnections int64   `json:"currentActiveConnections"`
+	Up                       bool    `json:"up"`
+	Draining                 bool    `json:"draining"`
+	ErrorRate                float64 `json:"errorRate"`
+	RequestsTotal            int64   `json:"requestsTotal"`
+}
+
+func newServerView(s *Server) serverView {
+	return serverView{
+		Id:                       s.Id,
+		URL:                      s.URL,
+		MaximumActiveConnections: atomic.LoadInt64(&s.MaximumActiveConnections),
+		CurrentActiveConnections: atomic.LoadInt64(&s.CurrentActiveConnections),
+		Up:                       s.Status.Load(),
+		Draining:                 s.draining.Load(),
+		ErrorRate:                s.ErrorRate(),
+		RequestsTotal:            atomic.LoadInt64(&s.reqCount),
+	}
+}
+
+// serverPatch is the request body for PATCH /api/servers/{id}: every field is
+// a pointer so an absent key leaves that setting untouched. Draining is
+// one-way (see Server.Drain) so patching it to false is a no-op.
+type serverPatch struct {
+	MaximumActiveConnections *int64 `json:"maximumActiveConnections"`
+	Enabled                  *bool  `json:"enabled"`
+	Draining                 *bool  `json:"draining"`
+}
+
+// requireAdminToken wraps next so it only runs when the request carries
+// "Authorization: Bearer <token>" matching token. An empty token disables the
+// check, which is the admin mux's default so the endpoints keep working for
+// anyone who hasn't opted into --admin-token.
+func requireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// pathServerID extracts the {id} segment from a request path of the form
+// prefix+"{id}" or prefix+"{id}/probe".
+func pathServerID(path, prefix string) (int, bool) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, prefix), "/")
+	rest = strings.TrimSuffix(rest, "/probe")
+	id, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// serversHandler serves GET /api/servers (list) and POST /api/servers (add).
+// defaultInterval supplies the health-check interval new servers fall back to
+// when they don't set their own ProbeIntervalSec.
+func serversHandler(lb *LoadBalancer, defaultInterval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			servers := lb.serverList()
+			views := make([]serverView, len(servers))
+			for i, s := range servers {
+				views[i] = newServerView(s)
+			}
+			writeJSON(w, http.StatusOK, views)
+
+		case http.MethodPost:
+			var sc config.ServerConfig
+			if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			s := newServerFromConfig(sc, defaultInterval)
+			wireServerTracing(lb, s)
+			if !lb.addServer(s) {
+				http.Error(w, "server id already exists", http.StatusConflict)
+				return
+			}
+			go activeHealthCheck(lb, s)
+			lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "ADDED"})
+
+			writeJSON(w, http.StatusCreated, newServerView(s))
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// serverHandler serves PATCH and DELETE for /api/servers/{id}.
+func serverHandler(lb *LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathServerID(r.URL.Path, "/api/servers/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s := lb.serverByID(id)
+		if s == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPatch:
+			var patch serverPatch
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if patch.MaximumActiveConnections != nil {
+				atomic.StoreInt64(&s.MaximumActiveConnections, *patch.MaximumActiveConnections)
+			}
+			if patch.Enabled != nil {
+				s.Status.Store(*patch.Enabled)
+				lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "admin toggled enabled"})
+			}
+			if patch.Draining != nil && *patch.Draining && !s.draining.Load() {
+				s.Drain()
+				lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "DRAINING (admin request)"})
+			}
+			writeJSON(w, http.StatusOK, newServerView(s))
+
+		case http.MethodDelete:
+			if !s.draining.Load() {
+				s.Drain()
+				lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "DRAINING (admin remove)"})
+				go removeWhenDrained(lb, s.Id)
+			}
+			w.WriteHeader(http.StatusAccepted)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// serverProbeHandler serves POST /api/servers/{id}/probe, running one active
+// health probe against the backend immediately instead of waiting for its
+// next ticker.
+func serverProbeHandler(lb *LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := pathServerID(r.URL.Path, "/api/servers/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s := lb.serverByID(id)
+		if s == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		client := &http.Client{Timeout: s.probeTimeout}
+		probeOnce(lb, s, client)
+		writeJSON(w, http.StatusOK, newServerView(s))
+	}
+}
+
+// serverSubpathHandler dispatches requests under /api/servers/ to the probe
+// handler when the path ends in /probe, and to the PATCH/DELETE handler
+// otherwise. ServeMux only routes on prefix, so the two share one pattern.
+func serverSubpathHandler(lb *LoadBalancer) http.HandlerFunc {
+	probe := serverProbeHandler(lb)
+	server := serverHandler(lb)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/probe") {
+			probe(w, r)
+			return
+		}
+		server(w, r)
+	}
+}
+
+// writeJSON encodes v as the response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Passive outlier detection: a backend that trips too many failures inside
+// outlierWindowDuration is ejected for ejectionCooldown, then offered back
+// as a single half-open trial request.
+const (
+	outlierWindowDuration     = 10 * time.Second
+	outlierMinRequests        = 5
+	outlierErrorRateThreshold = 0.5
+	ejectionCooldown          = 30 * time.Second
+)
+
+// HealthEventKind labels the kind of change a HealthEvent reports.
+type HealthEventKind string
+
+const (
+	HealthEventTransition HealthEventKind = "transition" // active probe flipped UP/DOWN, or a backend was added, toggled, drained or removed
+	HealthEventEjected    HealthEventKind = "ejected"    // passive outlier detection tripped
+	HealthEventRecovered  HealthEventKind = "recovered"  // half-open trial succeeded
+)
+
+// HealthEvent is a single observation from the health-check subsystem,
+// published on LoadBalancer.Events for the TUI or a future tracer to consume.
+type HealthEvent struct {
+	Time     time.Time
+	ServerId int
+	Kind     HealthEventKind
+	Detail   string
+}
+
+// applyHealthDefaults fills in zero-valued probe settings with sane defaults
+// and derives the unexported runtime fields (timeouts, intervals) from the
+// seconds the JSON config expresses them in. defaultInterval is used for any
+// server that doesn't set its own ProbeIntervalSec.
+func applyHealthDefaults(lb *LoadBalancer, defaultInterval time.Duration) {
+	for _, s := range lb.Servers {
+		applyServerDefaults(s, defaultInterval)
+	}
+}
+
+// applyServerDefaults is the single-server body of applyHealthDefaults, split
+// out so a server added after startup by the hot-reload watcher or the admin
+// API gets exactly the same defaulting as one loaded at boot.
+func applyServerDefaults(s *Server, defaultInterval time.Duration) {
+	if s.ProbePath == "" {
+		s.ProbePath = "/health"
+	}
+	if s.ProbeMethod == "" {
+		s.ProbeMethod = http.MethodGet
+	}
+	if len(s.ExpectedStatus) == 0 {
+		s.ExpectedStatus = []int{http.StatusOK}
+	}
+	if s.ProbeTimeoutSec <= 0 {
+		s.ProbeTimeoutSec = 5
+	}
+	if s.RiseThreshold <= 0 {
+		s.RiseThreshold = 2
+	}
+	if s.FallThreshold <= 0 {
+		s.FallThreshold = 3
+	}
+
+	s.probeTimeout = time.Duration(s.ProbeTimeoutSec) * time.Second
+	if s.ProbeIntervalSec > 0 {
+		s.probeInterval = time.Duration(s.ProbeIntervalSec) * time.Second
+	} else {
+		s.probeInterval = defaultInterval
+	}
+}
+
+// activeHealthCheck runs s's probe on its own ticker for as long as the
+// process lives. Each server ticks independently so one slow backend's probe
+// interval never throttles another's.
+func activeHealthCheck(lb *LoadBalancer, s *Server) {
+	client := &http.Client{Timeout: s.probeTimeout}
+	ticker := time.NewTicker(s.probeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		probeOnce(lb, s, client)
+	}
+}
+
+func probeOnce(lb *LoadBalancer, s *Server, client *http.Client) {
+	ok, failReason := probe(client, s)
+	if ok {
+		s.lastProbeErr.Store("")
+		atomic.StoreInt32(&s.consecutiveBad, 0)
+		oks := atomic.AddInt32(&s.consecutiveOK, 1)
+		if oks >= int32(s.RiseThreshold) && !s.Status.Load() {
+			s.Status.Store(true)
+			lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "UP"})
+		}
+		return
+	}
+
+	s.lastProbeErr.Store(failReason)
+	atomic.StoreInt32(&s.consecutiveOK, 0)
+	bad := atomic.AddInt32(&s.consecutiveBad, 1)
+	if bad >= int32(s.FallThreshold) && s.Status.Load() {
+		s.Status.Store(false)
+		lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "DOWN"})
+	}
+}
+
+// probe makes a single probe request against s and reports whether it met
+// the configured expectations, along with a short reason when it didn't.
+func probe(client *http.Client, s *Server) (ok bool, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, s.ProbeMethod, s.URL+s.ProbePath, nil)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err.Error()
+	}
+	defer resp.Body.Close()
+
+	statusOK := false
+	for _, code := range s.ExpectedStatus {
+		if resp.StatusCode == code {
+			statusOK = true
+			break
+		}
+	}
+	if !statusOK {
+		return false, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	if s.ExpectedBody == "" {
+		return true, ""
+	}
+
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return false, err.Error()
+	}
+	if !strings.Contains(body.String(), s.ExpectedBody) {
+		return false, "response body missing expected substring"
+	}
+	return true, ""
+}
+
+// outlierWindow is a small rolling window of pass/fail outcomes used for
+// passive circuit breaking, scoped to one backend.
+type outlierWindow struct {
+	mu     sync.Mutex
+	events []outlierEvent
+}
+
+type outlierEvent struct {
+	at     time.Time
+	failed bool
+}
+
+// record appends an outcome, drops events older than outlierWindowDuration,
+// and returns the total and failed counts left in the window.
+func (w *outlierWindow) record(failed bool) (total, errors int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.events = append(w.events, outlierEvent{at: now, failed: failed})
+
+	cutoff := now.Add(-outlierWindowDuration)
+	i := 0
+	for i < len(w.events) && w.events[i].at.Before(cutoff) {
+		i++
+	}
+	w.events = w.events[i:]
+
+	for _, e := range w.events {
+		total++
+		if e.failed {
+			errors++
+		}
+	}
+	return total, errors
+}
+
+func (w *outlierWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = nil
+}
+
+// halfOpenTrialAbandoned bounds how long a granted half-open trial can sit
+// unredeemed before another request is allowed to try the backend again.
+// Winning tryHalfOpenTrial only reserves a slot in a policy's candidate
+// pool; the policy is still free to pick a different live backend, in which
+// case recordOutcome never fires for this one and the reservation would
+// otherwise never be released.
+const halfOpenTrialAbandoned = 5 * time.Second
+
+// tryHalfOpenTrial reports whether this call is the one allowed to send a
+// half-open trial request to s once its ejection cooldown has elapsed,
+// gating out every other concurrent request so a backend that's still
+// broken gets one probe instead of a thundering herd.
+func (s *Server) tryHalfOpenTrial() bool {
+	now := time.Now().UnixNano()
+	if s.trialInFlight.CompareAndSwap(false, true) {
+		s.trialGrantedAt.Store(now)
+		return true
+	}
+	if now-s.trialGrantedAt.Load() > halfOpenTrialAbandoned.Nanoseconds() {
+		s.trialGrantedAt.Store(now)
+		return true
+	}
+	return false
+}
+
+// recordOutcome feeds one request's pass/fail result into s's passive outlier
+// detector. A server already ejected is instead treated as a half-open
+// trial: success un-ejects it, failure rearms the cooldown. Either way the
+// trial reservation tryHalfOpenTrial granted is released so the next
+// cooldown expiry (or this one, on failure) can hand out a fresh one.
+func (lb *LoadBalancer) recordOutcome(s *Server, failed bool) {
+	if s.ejected.Load() {
+		defer s.trialInFlight.Store(false)
+		if failed {
+			s.ejectedUntil.Store(time.Now().Add(ejectionCooldown).UnixNano())
+			return
+		}
+		s.ejected.Store(false)
+		s.window.reset()
+		lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventRecovered, Detail: "half-open trial succeeded"})
+		return
+	}
+
+	total, errors := s.window.record(failed)
+	if total < outlierMinRequests {
+		return
+	}
+	if float64(errors)/float64(total) < outlierErrorRateThreshold {
+		return
+	}
+
+	s.ejected.Store(true)
+	s.ejectedUntil.Store(time.Now().Add(ejectionCooldown).UnixNano())
+	lb.emit(HealthEvent{
+		ServerId: s.Id,
+		Kind:     HealthEventEjected,
+		Detail:   fmt.Sprintf("%d/%d requests failed in the last %s", errors, total, outlierWindowDuration),
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newEjectedServer(id int) *Server {
+	s := newTestServer(id)
+	s.ejected.Store(true)
+	s.ejectedUntil.Store(time.Now().Add(-time.Second).UnixNano()) // cooldown already elapsed
+	return s
+}
+
+func TestAvailableGrantsOnlyOneHalfOpenTrial(t *testing.T) {
+	s := newEjectedServer(1)
+
+	const n = 50
+	var wg sync.WaitGroup
+	var granted int32
+	var mu sync.Mutex
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.Available() {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != 1 {
+		t.Fatalf("Available() granted %d concurrent half-open trials, want exactly 1", granted)
+	}
+}
+
+func TestRecordOutcomeReleasesTrialOnSuccess(t *testing.T) {
+	lb := &LoadBalancer{Events: make(chan HealthEvent, 8)}
+	s := newEjectedServer(1)
+
+	if !s.Available() {
+		t.Fatal("Available() didn't grant the first trial")
+	}
+	if s.Available() {
+		t.Fatal("Available() granted a second concurrent trial before the first resolved")
+	}
+
+	lb.recordOutcome(s, false)
+
+	if s.ejected.Load() {
+		t.Fatal("recordOutcome(failed=false) left the server ejected")
+	}
+	if s.trialInFlight.Load() {
+		t.Fatal("recordOutcome didn't release the trial reservation on success")
+	}
+}
+
+func TestRecordOutcomeReleasesTrialOnFailureAndRearmsCooldown(t *testing.T) {
+	lb := &LoadBalancer{Events: make(chan HealthEvent, 8)}
+	s := newEjectedServer(1)
+
+	if !s.Available() {
+		t.Fatal("Available() didn't grant the first trial")
+	}
+
+	lb.recordOutcome(s, true)
+
+	if !s.ejected.Load() {
+		t.Fatal("recordOutcome(failed=true) un-ejected the server")
+	}
+	if s.trialInFlight.Load() {
+		t.Fatal("recordOutcome didn't release the trial reservation on failure")
+	}
+	if s.ejectedUntil.Load() <= time.Now().UnixNano() {
+		t.Fatal("recordOutcome(failed=true) didn't push ejectedUntil back out")
+	}
+	if s.Available() {
+		t.Fatal("Available() granted another trial before the rearmed cooldown elapsed")
+	}
+}
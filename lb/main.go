@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -10,10 +9,15 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/KostiantynYarosh/load-balancer/config"
+	"github.com/KostiantynYarosh/load-balancer/histogram"
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -26,18 +30,143 @@ type Server struct {
 	Status                   atomic.Bool
 	URL                      string
 	ReverseProxy             *httputil.ReverseProxy
+
+	// Active probe configuration. Zero values are filled in with sane
+	// defaults by applyServerDefaults.
+	ProbePath        string
+	ProbeMethod      string
+	ExpectedStatus   []int
+	ExpectedBody     string
+	ProbeTimeoutSec  int
+	ProbeIntervalSec int
+	RiseThreshold    int
+	FallThreshold    int
+
+	probeTimeout   time.Duration
+	probeInterval  time.Duration
+	consecutiveOK  int32
+	consecutiveBad int32
+	lastProbeErr   atomic.Value // string
+
+	// Passive outlier detection, driven from ServeHTTP.
+	window         outlierWindow
+	ejected        atomic.Bool
+	ejectedUntil   atomic.Int64
+	trialInFlight  atomic.Bool
+	trialGrantedAt atomic.Int64
+
+	// Metrics, also driven from ServeHTTP.
+	reqCount      int64
+	errCount      int64
+	bytesInTotal  int64
+	bytesOutTotal int64
+	latencyHist   *histogram.Histogram
+
+	// draining is set by Drain (an operator decision); see SafeToRemove.
+	draining atomic.Bool
+}
+
+// LastProbeError returns the reason the server's most recent active probe
+// failed, or "" if its last probe succeeded or none has run yet.
+func (s *Server) LastProbeError() string {
+	v, _ := s.lastProbeErr.Load().(string)
+	return v
+}
+
+// Available reports whether the server should be offered to a selection
+// policy: it must not be draining, and either it was never ejected or its
+// ejection cooldown has elapsed and it wins the half-open trial below.
+func (s *Server) Available() bool {
+	if s.draining.Load() {
+		return false
+	}
+	if !s.ejected.Load() {
+		return true
+	}
+	if time.Now().UnixNano() < s.ejectedUntil.Load() {
+		return false
+	}
+	return s.tryHalfOpenTrial()
 }
 
 type LoadBalancer struct {
-	Servers                []Server
+	Servers                []*Server
 	TotalActiveConnections int64
 	TotalRequests          int64
+	Policy                 SelectionPolicy  `json:"-"`
+	Events                 chan HealthEvent `json:"-"`
+	Tracer                 *Tracer          `json:"-"`
+	Metrics                *Metrics         `json:"-"`
+	AdminToken             string           `json:"-"`
+	inFlight               sync.WaitGroup
+
+	// mu guards Servers itself (the slice header), not the *Server values it
+	// points to: the hot-reload watcher and the admin API both replace the
+	// slice wholesale (copy-on-write) while requests are reading it.
+	mu sync.RWMutex
+}
+
+// emit publishes a health-check event to anyone listening on lb.Events (the
+// TUI's events tab, a future tracer). Slow or absent consumers never
+// block the health-check or request path.
+func (lb *LoadBalancer) emit(ev HealthEvent) {
+	ev.Time = time.Now()
+	select {
+	case lb.Events <- ev:
+	default:
+	}
+}
+
+// serverList returns the current server slice. Safe to call concurrently
+// with setServers; the caller gets either the old slice or the new one,
+// never a torn read.
+func (lb *LoadBalancer) serverList() []*Server {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.Servers
+}
+
+// setServers swaps in a new server slice, e.g. after the hot-reload watcher
+// or the admin API has computed the next state.
+func (lb *LoadBalancer) setServers(servers []*Server) {
+	lb.mu.Lock()
+	lb.Servers = servers
+	lb.mu.Unlock()
+}
+
+// addServer appends s to the server list, unless a server with the same id
+// is already present. The existence check and the append happen under a
+// single lock so concurrent POST /api/servers calls can't race each other
+// into a torn read-modify-write of the shared slice.
+func (lb *LoadBalancer) addServer(s *Server) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	for _, existing := range lb.Servers {
+		if existing.Id == s.Id {
+			return false
+		}
+	}
+	lb.Servers = append(lb.Servers, s)
+	return true
+}
+
+// serverByID returns the server with the given id, or nil.
+func (lb *LoadBalancer) serverByID(id int) *Server {
+	for _, s := range lb.serverList() {
+		if s.Id == id {
+			return s
+		}
+	}
+	return nil
 }
 
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lb.inFlight.Add(1)
+	defer lb.inFlight.Done()
+
 	atomic.AddInt64(&lb.TotalRequests, 1)
 
-	server := lb.selectServer()
+	server := lb.Policy.Select(r, lb.serverList())
 	if server == nil {
 		http.Error(w, "No available servers", http.StatusServiceUnavailable)
 		return
@@ -47,76 +176,94 @@ func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	atomic.AddInt64(&lb.TotalActiveConnections, 1)
 
 	defer func() {
-		atomic.AddInt64(&server.CurrentActiveConnections, -1)
+		remaining := atomic.AddInt64(&server.CurrentActiveConnections, -1)
 		atomic.AddInt64(&lb.TotalActiveConnections, -1)
+		if server.draining.Load() && remaining == 0 {
+			lb.emit(HealthEvent{ServerId: server.Id, Kind: HealthEventTransition, Detail: "DRAIN_COMPLETE"})
+		}
 	}()
 
-	server.ReverseProxy.ServeHTTP(w, r)
-}
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	tracedReq, tc := withTrace(r, server)
+	server.ReverseProxy.ServeHTTP(rec, tracedReq)
 
-func (lb *LoadBalancer) selectServer() *Server {
-	var optimalServer *Server
-	for i := 0; i < len(lb.Servers); i++ {
-		currentLoad := float64(atomic.LoadInt64(&lb.Servers[i].CurrentActiveConnections)) / float64(lb.Servers[i].MaximumActiveConnections)
-		if !lb.Servers[i].Status.Load() || currentLoad >= 1.0 {
-			continue
-		}
-		if optimalServer == nil {
-			optimalServer = &lb.Servers[i]
-			continue
-		}
-		optimalLoad := float64(atomic.LoadInt64(&optimalServer.CurrentActiveConnections)) / float64(optimalServer.MaximumActiveConnections)
-		if currentLoad < optimalLoad {
-			optimalServer = &lb.Servers[i]
-		}
+	failed := rec.status >= 500
+	lb.recordOutcome(server, failed)
+	lb.recordRequestMetrics(server, rec.status, time.Since(start), tc.bytesIn, rec.bytesOut)
+
+	healthErr := tc.backendErr
+	if healthErr == "" {
+		healthErr = server.LastProbeError()
 	}
-	return optimalServer
+	lb.Tracer.Record(Trace{
+		Time:        tc.start,
+		ClientAddr:  clientIP(r),
+		ServerId:    server.Id,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Status:      rec.status,
+		Latency:     time.Since(tc.start),
+		BytesIn:     tc.bytesIn,
+		BytesOut:    rec.bytesOut,
+		ReqHeaders:  r.Header,
+		RespHeaders: tc.respHeaders,
+		HealthErr:   healthErr,
+	})
 }
 
-func setupReversProxies(lb *LoadBalancer) {
-	for i := range lb.Servers {
-		serverURL, _ := url.Parse(lb.Servers[i].URL)
-		lb.Servers[i].ReverseProxy = httputil.NewSingleHostReverseProxy(serverURL)
-	}
+// statusRecorder captures the status code and response size a ReverseProxy
+// writes, including the status its default ErrorHandler writes on a
+// transport failure, so outlier detection and metrics can see them without
+// touching the proxy itself.
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	bytesOut int64
 }
 
-func healthCheck(lb *LoadBalancer, pause time.Duration) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	ticker := time.NewTicker(pause)
-	defer ticker.Stop()
-
-	for {
-		var wg sync.WaitGroup
-		for i := range lb.Servers {
-			wg.Add(1)
-			go func(serv *Server) {
-				defer wg.Done()
-				resp, err := client.Get(serv.URL + "/health")
-
-				newStatus := false
-				if err == nil && resp.StatusCode == 200 {
-					newStatus = true
-				}
-				if resp != nil {
-					resp.Body.Close()
-				}
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
 
-				serv.Status.Store(newStatus)
-			}(&lb.Servers[i])
-		}
-		wg.Wait()
-		<-ticker.C
-	}
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytesOut += int64(n)
+	return n, err
+}
+
+// setupReverseProxy builds server's ReverseProxy from its URL. Called from
+// newServerFromConfig, whether that's at startup, from the hot-reload
+// watcher, or from the admin API's add-server endpoint.
+func setupReverseProxy(server *Server) {
+	serverURL, _ := url.Parse(server.URL)
+	server.ReverseProxy = httputil.NewSingleHostReverseProxy(serverURL)
 }
 
 type tickMsg time.Time
 
+type tab int
+
+const (
+	serversTab tab = iota
+	tracesTab
+	eventsTab
+	tabCount
+)
+
+const tracesShown = 15
+const eventsShown = 15
+
 type model struct {
 	lb           *LoadBalancer
 	table        table.Model
 	lastRequests int64
 	lastTick     time.Time
 	rps          float64
+	activeTab    tab
+	traces       []Trace
+	events       []HealthEvent
 }
 
 func newModel(lb *LoadBalancer) model {
@@ -127,12 +274,13 @@ func newModel(lb *LoadBalancer) model {
 		{Title: "Conn", Width: 6},
 		{Title: "Max", Width: 6},
 		{Title: "Load %", Width: 8},
+		{Title: "Err %", Width: 7},
 	}
 
 	t := table.New(
 		table.WithColumns(columns),
-		table.WithFocused(false),
-		table.WithHeight(len(lb.Servers)+1),
+		table.WithFocused(true),
+		table.WithHeight(len(lb.serverList())+1),
 	)
 
 	s := table.DefaultStyles()
@@ -158,16 +306,43 @@ func tickCmd() tea.Cmd {
 	})
 }
 
+// healthEventMsg wraps a HealthEvent read off lb.Events so it can flow
+// through the Bubble Tea Update loop like any other message.
+type healthEventMsg HealthEvent
+
+// waitForEvent blocks on lb.Events and returns the next event as a tea.Msg.
+// Update re-issues this after every event so the TUI keeps draining the
+// channel for as long as the program runs; without it lb.emit's
+// non-blocking send would drop every event once the buffer filled.
+func waitForEvent(events chan HealthEvent) tea.Cmd {
+	return func() tea.Msg {
+		return healthEventMsg(<-events)
+	}
+}
+
 func (m model) Init() tea.Cmd {
-	return tickCmd()
+	return tea.Batch(tickCmd(), waitForEvent(m.lb.Events))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		if msg.String() == "q" || msg.String() == "ctrl+c" {
+		switch msg.String() {
+		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "tab":
+			m.activeTab = (m.activeTab + 1) % tabCount
+		case "d":
+			if m.activeTab == serversTab {
+				servers := m.lb.serverList()
+				if cursor := m.table.Cursor(); cursor >= 0 && cursor < len(servers) {
+					servers[cursor].Drain()
+				}
+			}
 		}
+		var cmd tea.Cmd
+		m.table, cmd = m.table.Update(msg)
+		return m, cmd
 	case tickMsg:
 		now := time.Time(msg)
 		elapsed := now.Sub(m.lastTick).Seconds()
@@ -178,27 +353,40 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.lastRequests = currentRequests
 		m.lastTick = now
 
+		servers := m.lb.serverList()
 		rows := []table.Row{}
-		for i := range m.lb.Servers {
-			srv := &m.lb.Servers[i]
+		for _, srv := range servers {
 			status := "DOWN"
 			if srv.Status.Load() {
 				status = "UP"
 			}
+			if srv.draining.Load() {
+				status = "DRAINING"
+			}
 			conn := atomic.LoadInt64(&srv.CurrentActiveConnections)
-			load := float64(conn) / float64(srv.MaximumActiveConnections) * 100
+			maxConn := atomic.LoadInt64(&srv.MaximumActiveConnections)
+			load := float64(conn) / float64(maxConn) * 100
 
 			rows = append(rows, table.Row{
 				fmt.Sprintf("%d", srv.Id),
 				srv.URL,
 				status,
 				fmt.Sprintf("%d", conn),
-				fmt.Sprintf("%d", srv.MaximumActiveConnections),
+				fmt.Sprintf("%d", maxConn),
 				fmt.Sprintf("%.1f%%", load),
+				fmt.Sprintf("%.1f%%", srv.ErrorRate()*100),
 			})
 		}
+		m.table.SetHeight(len(rows) + 1)
 		m.table.SetRows(rows)
+		m.traces = m.lb.Tracer.Last(tracesShown)
 		return m, tickCmd()
+	case healthEventMsg:
+		m.events = append(m.events, HealthEvent(msg))
+		if len(m.events) > eventsShown {
+			m.events = m.events[len(m.events)-eventsShown:]
+		}
+		return m, waitForEvent(m.lb.Events)
 	}
 	return m, nil
 }
@@ -215,52 +403,157 @@ func (m model) View() string {
 
 	title := titleStyle.Render(" Load Balancer")
 	stats := statsStyle.Render(fmt.Sprintf(
-		"Active Connections: %d  |  Total Requests: %d  |  RPS: %.1f",
+		"Active Connections: %d  |  Total Requests: %d  |  RPS: %.1f  |  p50: %s  p95: %s  p99: %s",
 		atomic.LoadInt64(&m.lb.TotalActiveConnections),
 		atomic.LoadInt64(&m.lb.TotalRequests),
 		m.rps,
+		m.lb.Metrics.latency.Quantile(0.5).Round(time.Millisecond),
+		m.lb.Metrics.latency.Quantile(0.95).Round(time.Millisecond),
+		m.lb.Metrics.latency.Quantile(0.99).Round(time.Millisecond),
 	))
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("#6272a4")).Render("\nPress 'q' to quit")
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("#6272a4")).Render("\nPress 'tab' to cycle servers/traces/events, 'd' to drain the selected backend, 'q' to quit")
+
+	body := m.table.View()
+	switch m.activeTab {
+	case tracesTab:
+		body = m.renderTraces()
+	case eventsTab:
+		body = m.renderEvents()
+	}
+
+	return fmt.Sprintf("%s\n%s\n%s%s", title, stats, body, help)
+}
+
+// statusStyle color-codes a trace's status the way an operator would expect:
+// green for success, yellow for client errors, red for server errors.
+func statusStyle(status int) lipgloss.Style {
+	switch {
+	case status >= 500:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555"))
+	case status >= 400:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#f1fa8c"))
+	case status >= 200:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#50fa7b"))
+	default:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#f8f8f2"))
+	}
+}
+
+func (m model) renderTraces() string {
+	if len(m.traces) == 0 {
+		return "No requests traced yet.\n"
+	}
+
+	var b strings.Builder
+	for i := len(m.traces) - 1; i >= 0; i-- {
+		tr := m.traces[i]
+		line := fmt.Sprintf("%s  %-4s %-30s %3d  %7.1fms  node %d",
+			tr.Time.Format("15:04:05.000"),
+			tr.Method,
+			tr.Path,
+			tr.Status,
+			float64(tr.Latency.Microseconds())/1000,
+			tr.ServerId,
+		)
+		b.WriteString(statusStyle(tr.Status).Render(line))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderEvents shows the most recent health events: active-probe UP/DOWN
+// transitions, passive outlier ejections/recoveries, and drain completions.
+func (m model) renderEvents() string {
+	if len(m.events) == 0 {
+		return "No health events yet.\n"
+	}
 
-	return fmt.Sprintf("%s\n%s\n%s%s", title, stats, m.table.View(), help)
+	var b strings.Builder
+	for i := len(m.events) - 1; i >= 0; i-- {
+		ev := m.events[i]
+		line := fmt.Sprintf("%s  node %d  %-10s %s",
+			ev.Time.Format("15:04:05.000"),
+			ev.ServerId,
+			ev.Kind,
+			ev.Detail,
+		)
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
 func main() {
 	log.SetOutput(io.Discard)
 	filepath := flag.String("servers", "", "path to a file with servers info")
-	healthPauseNum := flag.Int("health-timeout", 120, "Pause in seconds between running health check on servers")
+	healthPauseNum := flag.Int("health-timeout", 120, "Default pause in seconds between health checks for servers that don't set their own interval")
+	policyName := flag.String("policy", "least-conn", "selection policy: least-conn, weighted-round-robin, consistent-hash, p2c")
+	hashHeader := flag.String("hash-header", "", "header to hash on for the consistent-hash policy (defaults to client IP)")
+	adminAddr := flag.String("admin-addr", ":9090", "address for the admin endpoints: NDJSON request traces at /traces, Prometheus metrics at /metrics, and the JSON admin API at /api/servers")
+	traceCapacity := flag.Int("trace-capacity", 1000, "number of recent request traces to keep in memory")
+	redactHeaders := flag.String("redact-headers", "Authorization,Cookie", "comma-separated headers to redact in recorded traces")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "how long to wait for in-flight requests to finish on shutdown before forcing the listener closed")
+	adminToken := flag.String("admin-token", "", "if set, requests to the /api/servers admin API must carry Authorization: Bearer <token>")
+	watchConfigFlag := flag.Bool("watch-config", false, "watch --servers for changes and hot-reload the backend list")
 	flag.Parse()
 
-	healthPause := time.Duration(*healthPauseNum) * time.Second
+	defaultInterval := time.Duration(*healthPauseNum) * time.Second
 
-	serversInfoFile, err := os.ReadFile(*filepath)
+	cfg, err := config.Load(*filepath)
 	if err != nil {
 		fmt.Print(err)
 		return
 	}
 
 	var lb LoadBalancer
-	err = json.Unmarshal(serversInfoFile, &lb)
-	if err != nil {
-		fmt.Print(err)
-		return
+	lb.Servers = make([]*Server, len(cfg.Servers))
+	for i, sc := range cfg.Servers {
+		lb.Servers[i] = newServerFromConfig(sc, defaultInterval)
+	}
+
+	lb.Policy = newSelectionPolicy(*policyName, *hashHeader)
+	lb.Events = make(chan HealthEvent, 256)
+	lb.Tracer = NewTracer(*traceCapacity, strings.Split(*redactHeaders, ","))
+	lb.AdminToken = *adminToken
+
+	wireTracing(&lb)
+	initMetrics(&lb)
+
+	for _, server := range lb.Servers {
+		go activeHealthCheck(&lb, server)
 	}
 
-	setupReversProxies(&lb)
+	if *watchConfigFlag {
+		go watchConfig(&lb, *filepath, defaultInterval)
+	}
 
-	go healthCheck(&lb, healthPause)
+	go func() {
+		if err := http.ListenAndServe(*adminAddr, newAdminMux(&lb, lb.AdminToken, defaultInterval)); err != nil {
+			fmt.Println("Error starting admin server", err)
+		}
+	}()
 
+	server := &http.Server{Addr: ":8443", Handler: &lb}
 	go func() {
-		err = http.ListenAndServeTLS(":8443", "creds/cert.pem", "creds/key.pem", &lb)
-		if err != nil {
+		if err := server.ListenAndServeTLS("creds/cert.pem", "creds/key.pem"); err != nil && err != http.ErrServerClosed {
 			fmt.Println("Error starting server", err)
 			os.Exit(1)
 		}
 	}()
 
 	p := tea.NewProgram(newModel(&lb))
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		p.Send(tea.Quit())
+	}()
+
 	if _, err := p.Run(); err != nil {
 		fmt.Println("Error running TUI:", err)
 		os.Exit(1)
 	}
+
+	gracefulShutdown(&lb, server, *drainTimeout)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestAddServerConcurrentNoLostUpdates exercises the same read-append-write
+// shape POST /api/servers used to perform unlocked: many goroutines adding
+// distinct servers at once. Before addServer took a single lock around the
+// whole operation, this reliably dropped additions (run with -race to also
+// catch the data race on the shared slice).
+func TestAddServerConcurrentNoLostUpdates(t *testing.T) {
+	lb := &LoadBalancer{}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			lb.addServer(newTestServer(id))
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(lb.serverList()); got != n {
+		t.Fatalf("serverList() has %d servers after %d concurrent addServer calls, want %d", got, n, n)
+	}
+}
+
+func TestAddServerRejectsDuplicateID(t *testing.T) {
+	lb := &LoadBalancer{}
+
+	if !lb.addServer(newTestServer(1)) {
+		t.Fatal("addServer on an empty list rejected a fresh id")
+	}
+	if lb.addServer(newTestServer(1)) {
+		t.Fatal("addServer accepted a duplicate id")
+	}
+	if got := len(lb.serverList()); got != 1 {
+		t.Fatalf("serverList() has %d servers after a rejected duplicate add, want 1", got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/KostiantynYarosh/load-balancer/histogram"
+)
+
+// quantilesExposed are the percentiles reported on /metrics. The TUI shows
+// its own fixed p50/p95/p99.
+var quantilesExposed = []float64{0.5, 0.9, 0.95, 0.99}
+
+// Metrics holds the load balancer's global (cross-backend) measurements.
+// Per-backend counters and histograms live on Server itself.
+type Metrics struct {
+	latency *histogram.Histogram
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{latency: histogram.New()}
+}
+
+// initMetrics sets up the load balancer's global metrics. Each server gets
+// its own latency histogram from newServerFromConfig as it's built, so there
+// is nothing left to do per-server here.
+func initMetrics(lb *LoadBalancer) {
+	lb.Metrics = NewMetrics()
+}
+
+// recordRequestMetrics updates the global and per-backend counters for one
+// completed request. Called from ServeHTTP alongside recordOutcome.
+func (lb *LoadBalancer) recordRequestMetrics(s *Server, status int, latency time.Duration, bytesIn, bytesOut int64) {
+	atomic.AddInt64(&s.reqCount, 1)
+	if status >= 500 {
+		atomic.AddInt64(&s.errCount, 1)
+	}
+	if bytesIn > 0 {
+		atomic.AddInt64(&s.bytesInTotal, bytesIn)
+	}
+	if bytesOut > 0 {
+		atomic.AddInt64(&s.bytesOutTotal, bytesOut)
+	}
+
+	s.latencyHist.Observe(latency)
+	lb.Metrics.latency.Observe(latency)
+}
+
+// ErrorRate returns the fraction of this backend's requests that were 5xx.
+func (s *Server) ErrorRate() float64 {
+	total := atomic.LoadInt64(&s.reqCount)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.errCount)) / float64(total)
+}
+
+// metricsHandler serves /metrics in the Prometheus text exposition format.
+func metricsHandler(lb *LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# HELP lb_requests_total Total requests received.")
+		fmt.Fprintln(w, "# TYPE lb_requests_total counter")
+		fmt.Fprintf(w, "lb_requests_total %d\n", atomic.LoadInt64(&lb.TotalRequests))
+
+		fmt.Fprintln(w, "# HELP lb_inflight_requests Requests currently being proxied.")
+		fmt.Fprintln(w, "# TYPE lb_inflight_requests gauge")
+		fmt.Fprintf(w, "lb_inflight_requests %d\n", atomic.LoadInt64(&lb.TotalActiveConnections))
+
+		servers := lb.serverList()
+
+		fmt.Fprintln(w, "# HELP lb_backend_up Whether the backend's active health check currently reports it healthy.")
+		fmt.Fprintln(w, "# TYPE lb_backend_up gauge")
+		for _, s := range servers {
+			up := 0
+			if s.Status.Load() {
+				up = 1
+			}
+			fmt.Fprintf(w, "lb_backend_up{backend=\"%d\"} %d\n", s.Id, up)
+		}
+
+		fmt.Fprintln(w, "# HELP lb_backend_requests_total Requests proxied to this backend.")
+		fmt.Fprintln(w, "# TYPE lb_backend_requests_total counter")
+		for _, s := range servers {
+			fmt.Fprintf(w, "lb_backend_requests_total{backend=\"%d\"} %d\n", s.Id, atomic.LoadInt64(&s.reqCount))
+		}
+
+		fmt.Fprintln(w, "# HELP lb_backend_errors_total 5xx responses from this backend.")
+		fmt.Fprintln(w, "# TYPE lb_backend_errors_total counter")
+		for _, s := range servers {
+			fmt.Fprintf(w, "lb_backend_errors_total{backend=\"%d\"} %d\n", s.Id, atomic.LoadInt64(&s.errCount))
+		}
+
+		fmt.Fprintln(w, "# HELP lb_backend_bytes_in_total Request bytes sent to this backend.")
+		fmt.Fprintln(w, "# TYPE lb_backend_bytes_in_total counter")
+		for _, s := range servers {
+			fmt.Fprintf(w, "lb_backend_bytes_in_total{backend=\"%d\"} %d\n", s.Id, atomic.LoadInt64(&s.bytesInTotal))
+		}
+
+		fmt.Fprintln(w, "# HELP lb_backend_bytes_out_total Response bytes received from this backend.")
+		fmt.Fprintln(w, "# TYPE lb_backend_bytes_out_total counter")
+		for _, s := range servers {
+			fmt.Fprintf(w, "lb_backend_bytes_out_total{backend=\"%d\"} %d\n", s.Id, atomic.LoadInt64(&s.bytesOutTotal))
+		}
+
+		fmt.Fprintln(w, "# HELP lb_request_duration_seconds Request latency quantiles across all backends.")
+		fmt.Fprintln(w, "# TYPE lb_request_duration_seconds summary")
+		for _, q := range quantilesExposed {
+			fmt.Fprintf(w, "lb_request_duration_seconds{quantile=\"%.2f\"} %f\n", q, lb.Metrics.latency.Quantile(q).Seconds())
+		}
+
+		fmt.Fprintln(w, "# HELP lb_backend_request_duration_seconds Per-backend request latency quantiles.")
+		fmt.Fprintln(w, "# TYPE lb_backend_request_duration_seconds summary")
+		for _, s := range servers {
+			for _, q := range quantilesExposed {
+				fmt.Fprintf(w, "lb_backend_request_duration_seconds{backend=\"%d\",quantile=\"%.2f\"} %f\n", s.Id, q, s.latencyHist.Quantile(q).Seconds())
+			}
+		}
+	}
+}
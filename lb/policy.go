@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// SelectionPolicy picks which backend a request should be forwarded to.
+// Implementations must be safe for concurrent use: ServeHTTP calls Select
+// from every request goroutine.
+type SelectionPolicy interface {
+	Select(req *http.Request, servers []*Server) *Server
+}
+
+// healthyServers returns the servers that are up and not draining/ejected,
+// without regard to current load. This is the set ConsistentHashPolicy builds
+// its ring from: ring membership should only change when a backend's health
+// actually changes, not when it's momentarily full.
+func healthyServers(servers []*Server) []*Server {
+	healthy := make([]*Server, 0, len(servers))
+	for _, s := range servers {
+		if s.Status.Load() && s.Available() {
+			healthy = append(healthy, s)
+		}
+	}
+	return healthy
+}
+
+// hasCapacity reports whether s has room for another request.
+func hasCapacity(s *Server) bool {
+	load := float64(atomic.LoadInt64(&s.CurrentActiveConnections)) / float64(atomic.LoadInt64(&s.MaximumActiveConnections))
+	return load < 1.0
+}
+
+// liveServers returns the servers that are healthy and have spare capacity,
+// the candidate pool every policy below picks from except ConsistentHashPolicy,
+// which applies the capacity check itself at pick time (see Select).
+func liveServers(servers []*Server) []*Server {
+	healthy := healthyServers(servers)
+	live := make([]*Server, 0, len(healthy))
+	for _, s := range healthy {
+		if hasCapacity(s) {
+			live = append(live, s)
+		}
+	}
+	return live
+}
+
+// LeastConnectionsPolicy forwards each request to the live backend with the
+// lowest current-load ratio. This is the load balancer's original policy.
+type LeastConnectionsPolicy struct{}
+
+func (LeastConnectionsPolicy) Select(req *http.Request, servers []*Server) *Server {
+	var optimal *Server
+	var optimalLoad float64
+	for _, s := range liveServers(servers) {
+		load := float64(atomic.LoadInt64(&s.CurrentActiveConnections)) / float64(atomic.LoadInt64(&s.MaximumActiveConnections))
+		if optimal == nil || load < optimalLoad {
+			optimal = s
+			optimalLoad = load
+		}
+	}
+	return optimal
+}
+
+// WeightedRoundRobinPolicy distributes requests across servers in proportion
+// to their MaximumActiveConnections, using the smooth weighted round-robin
+// algorithm nginx uses: every pick, each server accumulates its own weight,
+// the highest accumulator wins, and the winner is then discounted by the
+// total weight so a heavier backend's picks are interleaved with the others'
+// rather than handed out in one burst.
+type WeightedRoundRobinPolicy struct {
+	mu      sync.Mutex
+	current map[int]int64
+}
+
+func NewWeightedRoundRobinPolicy() *WeightedRoundRobinPolicy {
+	return &WeightedRoundRobinPolicy{current: make(map[int]int64)}
+}
+
+func (p *WeightedRoundRobinPolicy) Select(req *http.Request, servers []*Server) *Server {
+	live := liveServers(servers)
+	if len(live) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var totalWeight int64
+	var best *Server
+	for _, s := range live {
+		weight := atomic.LoadInt64(&s.MaximumActiveConnections)
+		totalWeight += weight
+
+		p.current[s.Id] += weight
+		if best == nil || p.current[s.Id] > p.current[best.Id] {
+			best = s
+		}
+	}
+	p.current[best.Id] -= totalWeight
+	return best
+}
+
+// ConsistentHashPolicy maps each request to a backend by hashing a key (the
+// client IP by default, or the value of HashHeader when one is configured)
+// onto a hash ring built from virtual nodes per server. Adding or removing a
+// backend only remaps the keys that fell within its arc of the ring, roughly
+// 1/N of the keyspace, instead of reshuffling every client.
+type ConsistentHashPolicy struct {
+	HashHeader   string
+	VirtualNodes int
+
+	mu      sync.RWMutex
+	ring    []uint32
+	ringMap map[uint32]*Server
+	built   []*Server
+}
+
+func NewConsistentHashPolicy(hashHeader string) *ConsistentHashPolicy {
+	return &ConsistentHashPolicy{HashHeader: hashHeader, VirtualNodes: 150}
+}
+
+func (p *ConsistentHashPolicy) key(req *http.Request) string {
+	if p.HashHeader != "" {
+		if v := req.Header.Get(p.HashHeader); v != "" {
+			return v
+		}
+	}
+	return clientIP(req)
+}
+
+// clientIP returns the request's remote address with any port stripped.
+func clientIP(req *http.Request) string {
+	host := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func (p *ConsistentHashPolicy) rebuild(servers []*Server) {
+	ring := make([]uint32, 0, len(servers)*p.VirtualNodes)
+	ringMap := make(map[uint32]*Server, len(servers)*p.VirtualNodes)
+	for _, s := range servers {
+		for v := 0; v < p.VirtualNodes; v++ {
+			h := hashKey(fmt.Sprintf("%d-%d", s.Id, v))
+			ring = append(ring, h)
+			ringMap[h] = s
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+
+	p.ring = ring
+	p.ringMap = ringMap
+	p.built = servers
+}
+
+func sameServers(a, b []*Server) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *ConsistentHashPolicy) Select(req *http.Request, servers []*Server) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	p.mu.RLock()
+	stale := !sameServers(p.built, healthy)
+	p.mu.RUnlock()
+
+	if stale {
+		p.mu.Lock()
+		if !sameServers(p.built, healthy) {
+			p.rebuild(healthy)
+		}
+		p.mu.Unlock()
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.ring) == 0 {
+		return nil
+	}
+
+	h := hashKey(p.key(req))
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i] >= h })
+	if start == len(p.ring) {
+		start = 0
+	}
+
+	// Capacity is a per-pick check, not part of the ring: a backend that's
+	// momentarily full shouldn't trigger a rebuild, which would remap far
+	// more of the keyspace than just that backend's own arc. Walk forward
+	// from the hashed position for at most one lap over the distinct
+	// backends on the ring, skipping any that are at capacity, and fall
+	// back to the hashed backend if every one of them is saturated.
+	seen := make(map[int]bool, len(p.built))
+	for i := 0; i < len(p.ring); i++ {
+		idx := (start + i) % len(p.ring)
+		s := p.ringMap[p.ring[idx]]
+		if seen[s.Id] {
+			continue
+		}
+		seen[s.Id] = true
+		if hasCapacity(s) {
+			return s
+		}
+		if len(seen) == len(p.built) {
+			break
+		}
+	}
+	return p.ringMap[p.ring[start]]
+}
+
+// PowerOfTwoChoicesPolicy picks two live backends at random and forwards to
+// whichever currently has the lower load ratio. It is cheap to compute and,
+// under contention, provably close to the full-scan optimum.
+type PowerOfTwoChoicesPolicy struct{}
+
+func (PowerOfTwoChoicesPolicy) Select(req *http.Request, servers []*Server) *Server {
+	live := liveServers(servers)
+	switch len(live) {
+	case 0:
+		return nil
+	case 1:
+		return live[0]
+	}
+
+	a := live[rand.Intn(len(live))]
+	b := live[rand.Intn(len(live))]
+	for b == a {
+		b = live[rand.Intn(len(live))]
+	}
+
+	loadA := float64(atomic.LoadInt64(&a.CurrentActiveConnections)) / float64(atomic.LoadInt64(&a.MaximumActiveConnections))
+	loadB := float64(atomic.LoadInt64(&b.CurrentActiveConnections)) / float64(atomic.LoadInt64(&b.MaximumActiveConnections))
+	if loadA <= loadB {
+		return a
+	}
+	return b
+}
+
+// newSelectionPolicy builds the policy named by --policy. Unknown names fall
+// back to least-conn, the load balancer's original behaviour.
+func newSelectionPolicy(name, hashHeader string) SelectionPolicy {
+	switch name {
+	case "weighted-round-robin":
+		return NewWeightedRoundRobinPolicy()
+	case "consistent-hash":
+		return NewConsistentHashPolicy(hashHeader)
+	case "p2c":
+		return PowerOfTwoChoicesPolicy{}
+	default:
+		return LeastConnectionsPolicy{}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestServer(id int) *Server {
+	s := &Server{Id: id, MaximumActiveConnections: 100}
+	s.Status.Store(true)
+	return s
+}
+
+func reqWithIP(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":12345"
+	return r
+}
+
+func TestConsistentHashPolicySameKeySameServer(t *testing.T) {
+	p := NewConsistentHashPolicy("")
+	servers := []*Server{newTestServer(1), newTestServer(2), newTestServer(3)}
+
+	req := reqWithIP("10.0.0.1")
+	first := p.Select(req, servers)
+	for i := 0; i < 20; i++ {
+		if got := p.Select(req, servers); got != first {
+			t.Fatalf("Select(%v) = server %d on call %d, want the same server %d every time", req.RemoteAddr, got.Id, i, first.Id)
+		}
+	}
+}
+
+func TestConsistentHashPolicyRebalanceIsBounded(t *testing.T) {
+	p := NewConsistentHashPolicy("")
+	initial := []*Server{newTestServer(1), newTestServer(2), newTestServer(3), newTestServer(4)}
+
+	const n = 2000
+	before := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		req := reqWithIP(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		before[req.RemoteAddr] = p.Select(req, initial).Id
+	}
+
+	withExtra := append(append([]*Server{}, initial...), newTestServer(5))
+	moved := 0
+	for addr, prevID := range before {
+		req := reqWithIP(addr[:len(addr)-6])
+		got := p.Select(req, withExtra)
+		if got.Id != prevID {
+			moved++
+		}
+	}
+
+	// Adding a fifth server to four should only remap roughly 1/5 of keys; allow
+	// generous slack for virtual-node hash variance but catch a regression
+	// that rehashes everything (e.g. Select keying off slice order/index
+	// instead of a stable hash ring).
+	if maxMoved := n / 2; moved > maxMoved {
+		t.Errorf("adding a 5th server remapped %d/%d keys, want at most %d (consistent hashing should only move ~1/5)", moved, n, maxMoved)
+	}
+}
+
+func TestConsistentHashPolicySkipsUnavailableServers(t *testing.T) {
+	p := NewConsistentHashPolicy("")
+	draining := newTestServer(1)
+	draining.Drain()
+	live := newTestServer(2)
+
+	req := reqWithIP("10.0.0.1")
+	got := p.Select(req, []*Server{draining, live})
+	if got != live {
+		t.Fatalf("Select returned server %d, want the only non-draining server %d", got.Id, live.Id)
+	}
+}
+
+func TestConsistentHashPolicySaturationDoesNotReshapeRing(t *testing.T) {
+	p := NewConsistentHashPolicy("")
+	servers := []*Server{newTestServer(1), newTestServer(2), newTestServer(3)}
+
+	const n = 500
+	addrs := make([]string, n)
+	before := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		req := reqWithIP(fmt.Sprintf("10.1.%d.%d", i/256, i%256))
+		addrs[i] = req.RemoteAddr
+		before[req.RemoteAddr] = p.Select(req, servers).Id
+	}
+
+	// Saturate server 1. Keys that hash to it should be steered to a
+	// different live backend (the per-pick capacity check); keys that hash
+	// to anyone else must keep landing on the same backend as before,
+	// proving capacity never triggered a ring rebuild.
+	servers[0].CurrentActiveConnections = servers[0].MaximumActiveConnections
+
+	sawSkip := false
+	reshaped := 0
+	for _, addr := range addrs {
+		req := reqWithIP(addr[:len(addr)-6])
+		prevID := before[addr]
+		got := p.Select(req, servers)
+		if prevID == 1 {
+			if got.Id == 1 {
+				t.Fatalf("Select returned saturated server 1 for a key that hashed to it")
+			}
+			sawSkip = true
+			continue
+		}
+		if got.Id != prevID {
+			reshaped++
+		}
+	}
+
+	if !sawSkip {
+		t.Fatal("test setup produced no key hashing to server 1; adjust sample keys")
+	}
+	if reshaped > 0 {
+		t.Errorf("saturating one server remapped %d keys that didn't hash to it; capacity should be a per-pick skip, not a ring rebuild", reshaped)
+	}
+}
+
+func TestConsistentHashPolicyNoServersReturnsNil(t *testing.T) {
+	p := NewConsistentHashPolicy("")
+	if got := p.Select(reqWithIP("10.0.0.1"), nil); got != nil {
+		t.Fatalf("Select with no servers = %v, want nil", got)
+	}
+}
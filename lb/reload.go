@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/KostiantynYarosh/load-balancer/config"
+	"github.com/KostiantynYarosh/load-balancer/histogram"
+	"github.com/fsnotify/fsnotify"
+)
+
+// newServerFromConfig builds a fully wired *Server from one servers-file
+// entry: its ReverseProxy, probe defaults, and latency histogram. Used both
+// at startup and whenever the hot-reload watcher or the admin API introduces
+// a backend after the process is already running.
+func newServerFromConfig(sc config.ServerConfig, defaultInterval time.Duration) *Server {
+	s := &Server{
+		Id:                       sc.Id,
+		URL:                      sc.URL,
+		MaximumActiveConnections: sc.MaximumActiveConnections,
+		ProbePath:                sc.ProbePath,
+		ProbeMethod:              sc.ProbeMethod,
+		ExpectedStatus:           sc.ExpectedStatus,
+		ExpectedBody:             sc.ExpectedBody,
+		ProbeTimeoutSec:          sc.ProbeTimeoutSec,
+		ProbeIntervalSec:         sc.ProbeIntervalSec,
+		RiseThreshold:            sc.RiseThreshold,
+		FallThreshold:            sc.FallThreshold,
+	}
+	setupReverseProxy(s)
+	applyServerDefaults(s, defaultInterval)
+	s.latencyHist = histogram.New()
+	return s
+}
+
+// applyServerConfigUpdate copies the mutable fields of sc onto an existing
+// server in place, so counters, the reverse proxy, and health-check state
+// carry over across a reload instead of resetting. If the backend's URL
+// changed its ReverseProxy is rebuilt and re-wired for tracing.
+func applyServerConfigUpdate(lb *LoadBalancer, s *Server, sc config.ServerConfig, defaultInterval time.Duration) {
+	atomic.StoreInt64(&s.MaximumActiveConnections, sc.MaximumActiveConnections)
+
+	s.ProbePath = sc.ProbePath
+	s.ProbeMethod = sc.ProbeMethod
+	s.ExpectedStatus = sc.ExpectedStatus
+	s.ExpectedBody = sc.ExpectedBody
+	s.ProbeTimeoutSec = sc.ProbeTimeoutSec
+	s.ProbeIntervalSec = sc.ProbeIntervalSec
+	s.RiseThreshold = sc.RiseThreshold
+	s.FallThreshold = sc.FallThreshold
+	applyServerDefaults(s, defaultInterval)
+
+	if sc.URL != "" && sc.URL != s.URL {
+		s.URL = sc.URL
+		setupReverseProxy(s)
+		wireServerTracing(lb, s)
+	}
+}
+
+// reloadConfig re-reads path and applies the difference against lb's current
+// servers: new entries are added and start their own health check, existing
+// entries have their mutable fields updated in place, and entries that have
+// disappeared are drained and, once their in-flight requests finish, removed.
+func reloadConfig(lb *LoadBalancer, path string, defaultInterval time.Duration) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	current := lb.serverList()
+	byID := make(map[int]*Server, len(current))
+	for _, s := range current {
+		byID[s.Id] = s
+	}
+
+	seen := make(map[int]bool, len(cfg.Servers))
+	merged := make([]*Server, 0, len(current)+len(cfg.Servers))
+
+	for _, sc := range cfg.Servers {
+		seen[sc.Id] = true
+		if s, ok := byID[sc.Id]; ok {
+			applyServerConfigUpdate(lb, s, sc, defaultInterval)
+			merged = append(merged, s)
+			continue
+		}
+
+		s := newServerFromConfig(sc, defaultInterval)
+		wireServerTracing(lb, s)
+		merged = append(merged, s)
+		go activeHealthCheck(lb, s)
+		lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "ADDED"})
+	}
+
+	for _, s := range current {
+		if seen[s.Id] {
+			continue
+		}
+		merged = append(merged, s)
+		if s.draining.Load() {
+			continue
+		}
+		s.Drain()
+		lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "DRAINING (removed from config)"})
+		go removeWhenDrained(lb, s.Id)
+	}
+
+	lb.setServers(merged)
+	return nil
+}
+
+// removeWhenDrained polls s until it is safe to drop (draining, with no
+// in-flight requests left) and then removes it from lb's server list.
+func removeWhenDrained(lb *LoadBalancer, id int) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s := lb.serverByID(id)
+		if s == nil {
+			return
+		}
+		if !s.SafeToRemove() {
+			continue
+		}
+
+		lb.mu.Lock()
+		out := make([]*Server, 0, len(lb.Servers))
+		for _, existing := range lb.Servers {
+			if existing.Id != id {
+				out = append(out, existing)
+			}
+		}
+		lb.Servers = out
+		lb.mu.Unlock()
+
+		lb.emit(HealthEvent{ServerId: id, Kind: HealthEventTransition, Detail: "REMOVED"})
+		return
+	}
+}
+
+// watchConfig watches the directory containing path and reloads the server
+// list whenever it changes. The directory, rather than the file, is watched
+// because editors and config-management tools typically replace a file via
+// rename, which leaves a watch on the old inode seeing nothing.
+func watchConfig(lb *LoadBalancer, path string, defaultInterval time.Duration) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("config watch: failed to start:", err)
+		return
+	}
+	defer watcher.Close()
+
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		fmt.Println("config watch: failed to watch", dir, ":", err)
+		return
+	}
+
+	// Debounce: a single "save" can fire several fs events in quick
+	// succession (truncate, write, rename-into-place); wait for things to
+	// settle before reloading.
+	var debounce *time.Timer
+	reload := func() {
+		if err := reloadConfig(lb, path, defaultInterval); err != nil {
+			fmt.Println("config reload failed:", err)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(path) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(200*time.Millisecond, reload)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Println("config watch error:", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Drain marks s as draining: selection policies stop offering it new
+// requests (see Server.Available), but requests already in flight against it
+// are left to finish normally.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+// SafeToRemove reports whether s is draining and has no in-flight requests
+// left, i.e. it can be deleted from the server list without dropping a
+// request.
+func (s *Server) SafeToRemove() bool {
+	return s.draining.Load() && atomic.LoadInt64(&s.CurrentActiveConnections) == 0
+}
+
+// drainHandler serves POST /servers/drain?id=<id> on the admin listener,
+// marking the named backend as draining.
+func drainHandler(lb *LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+
+		s := lb.serverByID(id)
+		if s == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.Drain()
+		lb.emit(HealthEvent{ServerId: s.Id, Kind: HealthEventTransition, Detail: "DRAINING"})
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// gracefulShutdown stops server from accepting new connections, waits for
+// requests already in flight (tracked via lb.inFlight, incremented in
+// ServeHTTP) to finish, and force-closes anything still running after
+// drainTimeout.
+func gracefulShutdown(lb *LoadBalancer, server *http.Server, drainTimeout time.Duration) {
+	fmt.Println("graceful shutdown: draining in-flight requests")
+	server.SetKeepAlivesEnabled(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	// server.Shutdown stops the listener immediately and itself waits for
+	// active connections to go idle, so it has to run right away rather than
+	// after lb.inFlight drains: otherwise the listener keeps accepting new
+	// connections for the whole drain window, and those are exactly the
+	// requests left in flight when drainTimeout fires.
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- server.Shutdown(ctx) }()
+
+	drained := make(chan struct{})
+	go func() {
+		lb.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		fmt.Println("graceful shutdown: drain-timeout elapsed with requests still in flight")
+	}
+
+	if err := <-shutdownErr; err != nil {
+		server.Close()
+	}
+}
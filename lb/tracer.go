@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace is one request's worth of observability data: who asked, which
+// backend answered, how long it took, and what both sides said.
+type Trace struct {
+	Time        time.Time
+	ClientAddr  string
+	ServerId    int
+	Method      string
+	Path        string
+	Status      int
+	Latency     time.Duration
+	BytesIn     int64
+	BytesOut    int64
+	ReqHeaders  http.Header
+	RespHeaders http.Header
+	HealthErr   string
+}
+
+// shortTrace is the compact view returned unless the caller asks for verbose
+// output: no headers, just enough to eyeball in a terminal.
+type shortTrace struct {
+	Time      time.Time
+	Method    string
+	Path      string
+	Status    int
+	ServerId  int
+	LatencyMs float64
+}
+
+func (t Trace) short() shortTrace {
+	return shortTrace{
+		Time:      t.Time,
+		Method:    t.Method,
+		Path:      t.Path,
+		Status:    t.Status,
+		ServerId:  t.ServerId,
+		LatencyMs: float64(t.Latency.Microseconds()) / 1000,
+	}
+}
+
+// Tracer keeps a bounded ring of recent traces and fans each new one out to
+// live subscribers (the admin NDJSON endpoint). The TUI's traces tab reads
+// the ring through Last instead of subscribing.
+type Tracer struct {
+	mu            sync.Mutex
+	capacity      int
+	traces        []Trace
+	redactHeaders map[string]bool
+	subs          map[chan Trace]struct{}
+}
+
+// NewTracer builds a Tracer that keeps the last capacity traces and replaces
+// the value of any header in redactHeaders (case-insensitive) before storing
+// or publishing a trace.
+func NewTracer(capacity int, redactHeaders []string) *Tracer {
+	redact := make(map[string]bool, len(redactHeaders))
+	for _, h := range redactHeaders {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return &Tracer{
+		capacity:      capacity,
+		redactHeaders: redact,
+		subs:          make(map[chan Trace]struct{}),
+	}
+}
+
+func (t *Tracer) redact(h http.Header) http.Header {
+	if len(h) == 0 || len(t.redactHeaders) == 0 {
+		return h
+	}
+	clone := h.Clone()
+	for name := range t.redactHeaders {
+		if _, ok := clone[name]; ok {
+			clone[name] = []string{"REDACTED"}
+		}
+	}
+	return clone
+}
+
+// Record stores tr and publishes it to every live subscriber. Subscribers
+// that aren't keeping up are skipped rather than allowed to stall the
+// request path.
+func (t *Tracer) Record(tr Trace) {
+	tr.ReqHeaders = t.redact(tr.ReqHeaders)
+	tr.RespHeaders = t.redact(tr.RespHeaders)
+
+	t.mu.Lock()
+	t.traces = append(t.traces, tr)
+	if len(t.traces) > t.capacity {
+		t.traces = t.traces[len(t.traces)-t.capacity:]
+	}
+	for ch := range t.subs {
+		select {
+		case ch <- tr:
+		default:
+		}
+	}
+	t.mu.Unlock()
+}
+
+// Last returns up to n of the most recent traces, oldest first.
+func (t *Tracer) Last(n int) []Trace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n > len(t.traces) {
+		n = len(t.traces)
+	}
+	out := make([]Trace, n)
+	copy(out, t.traces[len(t.traces)-n:])
+	return out
+}
+
+// Subscribe registers a channel that receives every trace recorded after
+// this call. Callers must invoke the returned cancel func when done.
+func (t *Tracer) Subscribe() (ch chan Trace, cancel func()) {
+	ch = make(chan Trace, 64)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+
+	return ch, func() {
+		t.mu.Lock()
+		delete(t.subs, ch)
+		t.mu.Unlock()
+	}
+}
+
+// statusClassMatches implements the ?status= filter: either a 3-digit status
+// class like "5xx", or an exact status code like "404".
+func statusClassMatches(filter string, status int) bool {
+	if len(filter) == 3 && (filter[1] == 'x' || filter[1] == 'X') && (filter[2] == 'x' || filter[2] == 'X') {
+		return status/100 == int(filter[0]-'0')
+	}
+	if code, err := strconv.Atoi(filter); err == nil {
+		return status == code
+	}
+	return true
+}
+
+// tracesHandler serves GET /traces on the admin listener: it replays the
+// buffered history, then streams new traces as NDJSON until the client
+// disconnects. Supports ?status=5xx, ?node=<id>, ?path=<prefix>, and
+// ?verbose=1 for full headers instead of the short summary line.
+func tracesHandler(lb *LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		statusFilter := q.Get("status")
+		pathFilter := q.Get("path")
+		verbose := q.Get("verbose") == "1"
+
+		hasNode := false
+		var nodeID int
+		if v := q.Get("node"); v != "" {
+			if id, err := strconv.Atoi(v); err == nil {
+				nodeID, hasNode = id, true
+			}
+		}
+
+		matches := func(tr Trace) bool {
+			if statusFilter != "" && !statusClassMatches(statusFilter, tr.Status) {
+				return false
+			}
+			if hasNode && tr.ServerId != nodeID {
+				return false
+			}
+			if pathFilter != "" && !strings.HasPrefix(tr.Path, pathFilter) {
+				return false
+			}
+			return true
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+
+		write := func(tr Trace) {
+			if !matches(tr) {
+				return
+			}
+			if verbose {
+				enc.Encode(tr)
+			} else {
+				enc.Encode(tr.short())
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		for _, tr := range lb.Tracer.Last(lb.Tracer.capacity) {
+			write(tr)
+		}
+
+		ch, cancel := lb.Tracer.Subscribe()
+		defer cancel()
+		for {
+			select {
+			case tr := <-ch:
+				write(tr)
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// newAdminMux builds the handler for the admin listener: request traces,
+// Prometheus metrics, the legacy one-off drain endpoint, and the JSON admin
+// API (list/add/remove/patch/probe a backend). Only the admin API is gated
+// behind adminToken; the rest predate it and stay open.
+func newAdminMux(lb *LoadBalancer, adminToken string, defaultInterval time.Duration) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/traces", tracesHandler(lb))
+	mux.HandleFunc("/metrics", metricsHandler(lb))
+	mux.HandleFunc("/servers/drain", drainHandler(lb))
+	mux.HandleFunc("/api/servers", requireAdminToken(adminToken, serversHandler(lb, defaultInterval)))
+	mux.HandleFunc("/api/servers/", requireAdminToken(adminToken, serverSubpathHandler(lb)))
+	return mux
+}
+
+// traceCtxKey is the context key ServeHTTP attaches a *traceContext under so
+// a server's Transport and ModifyResponse hook can find it again.
+type traceCtxKey struct{}
+
+// traceContext carries the per-request state the tracer needs across the
+// ReverseProxy's Transport, ModifyResponse and ErrorHandler hooks. ServeHTTP
+// reads it back once the proxy call returns and uses it, together with the
+// statusRecorder it wraps the response in, to build the final Trace: that
+// way BytesOut/BytesIn come from bytes actually observed on the wire rather
+// than a possibly-absent Content-Length header.
+type traceContext struct {
+	start       time.Time
+	server      *Server
+	bytesIn     int64
+	respHeaders http.Header
+	backendErr  string
+}
+
+// countingReadCloser tallies bytes read from the wrapped body so the
+// Transport hook can report how much of the request the backend consumed.
+type countingReadCloser struct {
+	io.ReadCloser
+	counter *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	*c.counter += int64(n)
+	return n, err
+}
+
+// tracingTransport wraps a server's RoundTripper to count request bytes as
+// they're streamed to the backend.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tc, ok := req.Context().Value(traceCtxKey{}).(*traceContext); ok && req.Body != nil {
+		req.Body = &countingReadCloser{ReadCloser: req.Body, counter: &tc.bytesIn}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// wireTracing attaches the Transport and ModifyResponse/ErrorHandler hooks
+// that feed lb.Tracer to every server's ReverseProxy. Call after each
+// server's ReverseProxy has been built.
+func wireTracing(lb *LoadBalancer) {
+	for _, server := range lb.Servers {
+		wireServerTracing(lb, server)
+	}
+}
+
+// wireServerTracing is wireTracing's per-server body, split out so a server
+// built after startup (hot reload, the admin API) can be wired the same way
+// without re-running it across the whole fleet.
+func wireServerTracing(lb *LoadBalancer, server *Server) {
+	rp := server.ReverseProxy
+	rp.Transport = &tracingTransport{base: http.DefaultTransport}
+
+	// ModifyResponse and ErrorHandler only stash what they alone can see
+	// (response headers, the transport error); they don't record the trace
+	// themselves. ServeHTTP does that once the proxy call returns, using the
+	// statusRecorder's actual byte count rather than resp.ContentLength,
+	// which is 0 or -1 for chunked or otherwise unknown-length responses.
+	rp.ModifyResponse = func(resp *http.Response) error {
+		if tc, ok := resp.Request.Context().Value(traceCtxKey{}).(*traceContext); ok {
+			tc.respHeaders = resp.Header
+		}
+		return nil
+	}
+
+	rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		if tc, ok := req.Context().Value(traceCtxKey{}).(*traceContext); ok {
+			tc.backendErr = err.Error()
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// withTrace attaches a fresh *traceContext to req's context for server so
+// the tracing hooks above can find it, and returns that context alongside
+// the request so the caller can use it once the proxy call returns.
+func withTrace(req *http.Request, server *Server) (*http.Request, *traceContext) {
+	tc := &traceContext{start: time.Now(), server: server}
+	return req.WithContext(context.WithValue(req.Context(), traceCtxKey{}, tc)), tc
+}